@@ -0,0 +1,210 @@
+package sqlite
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCompileRoundTrip(t *testing.T) {
+	cases := []string{
+		"CREATE TABLE `users` (`id` INTEGER PRIMARY KEY AUTOINCREMENT,`name` VARCHAR(100) NOT NULL)",
+		"CREATE TABLE `orders` (`id` INTEGER PRIMARY KEY,`amount` NUMERIC(10,2),`user_id` INTEGER,CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE)",
+		"CREATE TABLE `t` (`id` INTEGER,`price` NUMERIC(10,2),`created` DATETIME DEFAULT (datetime('now')),`full` TEXT GENERATED ALWAYS AS (upper(name)) STORED)",
+	}
+
+	for _, sql := range cases {
+		t.Run(sql, func(t *testing.T) {
+			d, err := parseDDL(sql)
+			if err != nil {
+				t.Fatalf("parseDDL() error = %v", err)
+			}
+
+			d2, err := parseDDL(d.compile())
+			if err != nil {
+				t.Fatalf("reparse error = %v", err)
+			}
+
+			if got, want := d2.compile(), d.compile(); got != want {
+				t.Errorf("round-trip mismatch:\n got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+func TestColumnArgs(t *testing.T) {
+	cases := []struct {
+		name          string
+		column        string
+		wantLength    int64
+		wantPrecision int64
+		wantScale     int64
+	}{
+		{name: "single arg sets length, not precision", column: "`name` VARCHAR(255)", wantLength: 255},
+		{name: "two args set precision and scale", column: "`price` NUMERIC(10,2)", wantPrecision: 10, wantScale: 2},
+		{name: "no args leaves everything zero", column: "`flag` BOOLEAN"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := parseDDL("CREATE TABLE `t` (" + c.column + ")")
+			if err != nil {
+				t.Fatalf("parseDDL() error = %v", err)
+			}
+			col := d.columns[0]
+			if col.Length != c.wantLength {
+				t.Errorf("Length = %d, want %d", col.Length, c.wantLength)
+			}
+			if col.Precision != c.wantPrecision {
+				t.Errorf("Precision = %d, want %d", col.Precision, c.wantPrecision)
+			}
+			if col.Scale != c.wantScale {
+				t.Errorf("Scale = %d, want %d", col.Scale, c.wantScale)
+			}
+		})
+	}
+}
+
+func TestDefaultExprParensPreserved(t *testing.T) {
+	d, err := parseDDL("CREATE TABLE `t` (`created` DATETIME DEFAULT (datetime('now')),`n` INTEGER DEFAULT 0)")
+	if err != nil {
+		t.Fatalf("parseDDL() error = %v", err)
+	}
+
+	created, n := d.columns[0], d.columns[1]
+
+	if !created.DefaultIsExpr || created.Default != "datetime('now')" {
+		t.Errorf("created: DefaultIsExpr=%v Default=%q, want expr datetime('now')", created.DefaultIsExpr, created.Default)
+	}
+	if n.DefaultIsExpr || n.Default != "0" {
+		t.Errorf("n: DefaultIsExpr=%v Default=%q, want literal 0", n.DefaultIsExpr, n.Default)
+	}
+
+	compiled := d.compile()
+	if want := "DEFAULT (datetime('now'))"; !strings.Contains(compiled, want) {
+		t.Errorf("compile() = %q, want it to contain %q", compiled, want)
+	}
+	if want := "DEFAULT 0"; !strings.Contains(compiled, want) {
+		t.Errorf("compile() = %q, want it to contain %q", compiled, want)
+	}
+}
+
+func TestForeignKeyOnDeleteRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		sql  string
+	}{
+		{
+			name: "column-level REFERENCES",
+			sql:  "CREATE TABLE `orders` (`user_id` INTEGER REFERENCES `users` (`id`) ON DELETE CASCADE)",
+		},
+		{
+			name: "table-level FOREIGN KEY",
+			sql:  "CREATE TABLE `orders` (`user_id` INTEGER,CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE SET NULL)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := parseDDL(c.sql)
+			if err != nil {
+				t.Fatalf("parseDDL() error = %v", err)
+			}
+
+			var ref *FKRef
+			if len(d.columns) > 0 && d.columns[0].References != nil {
+				ref = d.columns[0].References
+			} else if len(d.constraints) > 0 {
+				ref = d.constraints[0].Refs
+			}
+			if ref == nil {
+				t.Fatal("expected a parsed FKRef")
+			}
+			if ref.OnDelete == "" {
+				t.Error("OnDelete is empty, want CASCADE/SET NULL")
+			}
+
+			d2, err := parseDDL(d.compile())
+			if err != nil {
+				t.Fatalf("reparse error = %v", err)
+			}
+			if d2.compile() != d.compile() {
+				t.Errorf("round-trip mismatch:\n got: %s\nwant: %s", d2.compile(), d.compile())
+			}
+		})
+	}
+}
+
+func TestGeneratedColumnHandling(t *testing.T) {
+	d, err := parseDDL("CREATE TABLE `t` (`id` INTEGER,`full` TEXT GENERATED ALWAYS AS (upper(name)) STORED)")
+	if err != nil {
+		t.Fatalf("parseDDL() error = %v", err)
+	}
+
+	gen := d.columns[1]
+	if gen.GeneratedExpr != "upper(name)" || !gen.GeneratedStored {
+		t.Errorf("GeneratedExpr=%q GeneratedStored=%v, want upper(name)/true", gen.GeneratedExpr, gen.GeneratedStored)
+	}
+
+	if got := d.getColumns(); len(got) != 1 || got[0] != "`id`" {
+		t.Errorf("getColumns() = %v, want only `id` (INSERT can't target a GENERATED column)", got)
+	}
+	if got := d.selectColumns(); len(got) != 2 {
+		t.Errorf("selectColumns() = %v, want both id and full (SELECT * returns GENERATED columns too)", got)
+	}
+}
+
+func TestDiffDDLToSQL(t *testing.T) {
+	t.Run("add column uses a plain ALTER TABLE", func(t *testing.T) {
+		diff, err := DiffDDL(
+			"CREATE TABLE `t` (`id` INTEGER,`name` TEXT)",
+			"CREATE TABLE `t` (`id` INTEGER,`name` TEXT,`email` TEXT)",
+		)
+		if err != nil {
+			t.Fatalf("DiffDDL() error = %v", err)
+		}
+
+		stmts := diff.ToSQL("sqlite")
+		if len(stmts) != 1 || stmts[0] != "ALTER TABLE `t` ADD COLUMN `email` TEXT" {
+			t.Errorf("ToSQL() = %v, want a single ADD COLUMN statement", stmts)
+		}
+	})
+
+	t.Run("dropped or retyped columns require a rebuild", func(t *testing.T) {
+		diff, err := DiffDDL(
+			"CREATE TABLE `t` (`id` INTEGER,`name` TEXT,`age` INTEGER)",
+			"CREATE TABLE `t` (`id` INTEGER,`name` VARCHAR(50))",
+		)
+		if err != nil {
+			t.Fatalf("DiffDDL() error = %v", err)
+		}
+
+		stmts := diff.ToSQL("sqlite")
+		want := []string{
+			"PRAGMA legacy_alter_table=ON",
+			"CREATE TABLE `t__new` (`id` INTEGER,`name` VARCHAR(50))",
+			"INSERT INTO `t__new` (`id`,`name`) SELECT `id`,`name` FROM `t`",
+			"DROP TABLE `t`",
+			"ALTER TABLE `t__new` RENAME TO `t`",
+			"PRAGMA foreign_key_check",
+			"PRAGMA legacy_alter_table=OFF",
+		}
+		if len(stmts) != len(want) {
+			t.Fatalf("ToSQL() = %v, want %v", stmts, want)
+		}
+		for i := range want {
+			if stmts[i] != want[i] {
+				t.Errorf("ToSQL()[%d] = %q, want %q", i, stmts[i], want[i])
+			}
+		}
+	})
+
+	t.Run("unsupported dialect yields nothing", func(t *testing.T) {
+		diff, err := DiffDDL("CREATE TABLE `t` (`id` INTEGER)", "CREATE TABLE `t` (`id` INTEGER,`n` INTEGER)")
+		if err != nil {
+			t.Fatalf("DiffDDL() error = %v", err)
+		}
+		if stmts := diff.ToSQL("postgres"); stmts != nil {
+			t.Errorf("ToSQL(\"postgres\") = %v, want nil", stmts)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	deleteRegexp = regexp.MustCompile(`(?is)^\s*DELETE\s+FROM\s+(` + "`" + `[^` + "`" + `]+` + "`" + `|\S+)\s*(WHERE[\s\S]*)?$`)
+	updateRegexp = regexp.MustCompile(`(?is)^\s*UPDATE\s+(` + "`" + `[^` + "`" + `]+` + "`" + `|\S+)\s+SET\s+[\s\S]*?(WHERE[\s\S]*)?$`)
+)
+
+func init() {
+	Register(Rule{
+		Name:        "dml2select",
+		Description: "将 DELETE/UPDATE 改写为等价的 SELECT *,用于 EXPLAIN 代价评估",
+		Fn:          dml2select,
+	})
+}
+
+// dml2select 把 DELETE FROM t WHERE ... / UPDATE t SET ... WHERE ... 改写成
+// SELECT * FROM t WHERE ...,这样可以直接跑 EXPLAIN 来估算受影响行数的代价,
+// 而不需要真的执行会产生副作用的语句
+func dml2select(r *Statement) *Statement {
+	sql := strings.TrimSpace(r.SQL)
+
+	if m := deleteRegexp.FindStringSubmatch(sql); m != nil {
+		r.SQL = fmt.Sprintf("SELECT * FROM %s%s", m[1], withLeadingSpace(m[2]))
+		return r
+	}
+
+	if m := updateRegexp.FindStringSubmatch(sql); m != nil {
+		r.SQL = fmt.Sprintf("SELECT * FROM %s%s", m[1], withLeadingSpace(m[2]))
+		return r
+	}
+
+	return r
+}
+
+func withLeadingSpace(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " " + s
+}
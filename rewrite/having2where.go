@@ -0,0 +1,164 @@
+package rewrite
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	whereRegexp      = regexp.MustCompile(`(?i)\bWHERE\b`)
+	groupByRegexp    = regexp.MustCompile(`(?is)^([\s\S]*?)\bGROUP BY\b([\s\S]*?)\bHAVING\b([\s\S]*)$`)
+	aggregateRegexp  = regexp.MustCompile(`(?i)\b(COUNT|SUM|AVG|MIN|MAX)\s*\(`)
+	selectListRegexp = regexp.MustCompile(`(?is)\bSELECT\b(?:\s+DISTINCT)?\s+([\s\S]*?)\s+\bFROM\b`)
+	selectAsRegexp   = regexp.MustCompile(`(?i)\bAS\s+(` + "`" + `[^` + "`" + `]+` + "`" + `|"[^"]+"|[\w]+)\s*$`)
+	identifierRegexp = regexp.MustCompile(`[\w]+`)
+)
+
+func init() {
+	Register(Rule{
+		Name:        "having2where",
+		Description: "把 HAVING 中不引用聚合函数的条件下推到 WHERE,缩小分组前需要处理的行数",
+		Fn:          having2where,
+	})
+}
+
+// having2where 把 HAVING 里按 AND 连接的条件拆开,凡是不含聚合函数调用的条件
+// 都挪到 WHERE 里提前过滤,只把真正依赖聚合结果的条件留在 HAVING
+func having2where(r *Statement) *Statement {
+	m := groupByRegexp.FindStringSubmatch(r.SQL)
+	if m == nil {
+		return r
+	}
+
+	head, groupBy, having := m[1], m[2], m[3]
+	aliases := aggregateAliases(head)
+
+	var keepInHaving, pushToWhere []string
+	for _, cond := range splitTopLevelAnd(having) {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+		if aggregateRegexp.MatchString(cond) || referencesAlias(cond, aliases) {
+			keepInHaving = append(keepInHaving, cond)
+		} else {
+			pushToWhere = append(pushToWhere, cond)
+		}
+	}
+
+	if len(pushToWhere) == 0 {
+		return r
+	}
+
+	if whereRegexp.MatchString(head) {
+		head = strings.TrimRight(head, " ") + " AND " + strings.Join(pushToWhere, " AND ") + " "
+	} else {
+		head = strings.TrimRight(head, " ") + " WHERE " + strings.Join(pushToWhere, " AND ") + " "
+	}
+
+	var rebuilt strings.Builder
+	rebuilt.WriteString(head)
+	rebuilt.WriteString("GROUP BY")
+	rebuilt.WriteString(groupBy)
+	if len(keepInHaving) > 0 {
+		rebuilt.WriteString("HAVING ")
+		rebuilt.WriteString(strings.Join(keepInHaving, " AND "))
+	}
+
+	r.SQL = strings.TrimSpace(rebuilt.String())
+	return r
+}
+
+// aggregateAliases 从 "SELECT ... FROM" 的选择列表中找出绑定到聚合表达式的
+// 别名(如 "SUM(x) AS total" 里的 total),这些别名在 WHERE 里是不可见的,
+// having2where 必须把引用它们的条件留在 HAVING,而不是只看条件本身有没有
+// 聚合函数调用
+func aggregateAliases(head string) map[string]bool {
+	m := selectListRegexp.FindStringSubmatch(head)
+	if m == nil {
+		return nil
+	}
+
+	aliases := map[string]bool{}
+	for _, item := range splitTopLevelComma(m[1]) {
+		if !aggregateRegexp.MatchString(item) {
+			continue
+		}
+		if am := selectAsRegexp.FindStringSubmatch(item); am != nil {
+			aliases[strings.ToUpper(unquoteSelectAlias(am[1]))] = true
+		}
+	}
+	return aliases
+}
+
+// referencesAlias 判断 cond 是否以整词的形式引用了 aliases 中的任意一个别名
+func referencesAlias(cond string, aliases map[string]bool) bool {
+	if len(aliases) == 0 {
+		return false
+	}
+	for _, word := range identifierRegexp.FindAllString(cond, -1) {
+		if aliases[strings.ToUpper(word)] {
+			return true
+		}
+	}
+	return false
+}
+
+// unquoteSelectAlias 去掉别名两侧的 `, " 包裹(如果存在)
+func unquoteSelectAlias(alias string) string {
+	if len(alias) >= 2 {
+		if (alias[0] == '`' && alias[len(alias)-1] == '`') || (alias[0] == '"' && alias[len(alias)-1] == '"') {
+			return alias[1 : len(alias)-1]
+		}
+	}
+	return alias
+}
+
+// splitTopLevelComma 按顶层逗号切分选择列表项,忽略括号内部的逗号
+func splitTopLevelComma(s string) []string {
+	var items []string
+	depth := 0
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	items = append(items, s[last:])
+	return items
+}
+
+// splitTopLevelAnd 按顶层 " AND " 切分表达式,忽略括号内部的 AND
+func splitTopLevelAnd(s string) []string {
+	var parts []string
+	depth := 0
+	last := 0
+	upper := strings.ToUpper(s)
+
+	i := 0
+	for i < len(s) {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 && strings.HasPrefix(upper[i:], " AND ") {
+			parts = append(parts, s[last:i])
+			i += len(" AND ")
+			last = i
+			continue
+		}
+		i++
+	}
+	parts = append(parts, s[last:])
+	return parts
+}
@@ -0,0 +1,36 @@
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	selectRegexp = regexp.MustCompile(`(?i)^\s*SELECT\b`)
+	limitRegexp  = regexp.MustCompile(`(?i)\bLIMIT\s+\d+`)
+)
+
+// defaultLimit 是 "limit" 规则在调用方未显式配置时追加的默认行数上限
+var defaultLimit = 1000
+
+func init() {
+	Register(Rule{
+		Name:        "limit",
+		Description: "为没有 LIMIT 子句的 SELECT 追加默认行数上限",
+		Fn:          limit,
+	})
+}
+
+// SetDefaultLimit 配置 "limit" 规则在 SELECT 缺省 LIMIT 时追加的行数
+func SetDefaultLimit(n int) {
+	defaultLimit = n
+}
+
+func limit(r *Statement) *Statement {
+	if !selectRegexp.MatchString(r.SQL) || limitRegexp.MatchString(r.SQL) {
+		return r
+	}
+	r.SQL = fmt.Sprintf("%s LIMIT %d", strings.TrimRight(strings.TrimSpace(r.SQL), ";"), defaultLimit)
+	return r
+}
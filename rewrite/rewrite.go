@@ -0,0 +1,65 @@
+// Package rewrite 提供一套可插拔的 SQL 改写/检查规则,用于 SQLite 方言的
+// 查询优化与线下分析。规则通过 Register 注册到全局表中,调用方按名字启用
+// 一部分规则,Rewrite 按固定顺序把它们串起来依次应用。
+//
+// 该包被设计为可作为 dialector 的可选 QueryHook 接入:调用方在执行 SQL 前
+// 把语句和会话里通过 db.Set("sqlite:rewrite_rules", []string{...}) 配置的
+// 规则名传给 Rewrite,拿到改写后的语句再送去执行/EXPLAIN。
+package rewrite
+
+import "fmt"
+
+// Statement 携带一条 SQL 语句在规则链中传递的状态
+type Statement struct {
+	SQL string
+}
+
+// Rule 是一条可注册的改写/检查规则
+type Rule struct {
+	Name        string
+	Description string
+	Fn          func(*Statement) *Statement
+}
+
+var registry = map[string]Rule{}
+
+// ruleOrder 固定了已注册规则的执行顺序,与调用方传入 Rewrite 的 rules 顺序无关
+var ruleOrder []string
+
+// Register 把一条规则加入全局注册表,重名会覆盖
+func Register(rule Rule) {
+	if _, exists := registry[rule.Name]; !exists {
+		ruleOrder = append(ruleOrder, rule.Name)
+	}
+	registry[rule.Name] = rule
+}
+
+// columnLookup 由调用方注入,用来获取表的列名;sqlite 包的 EnableRewrite
+// 注入的是按表缓存列名的 ColumnLookup,避免 star2columns 每次都去查 sqlite_master
+var columnLookup func(table string) ([]string, error)
+
+// SetColumnLookup 注册 star2columns 规则展开 `SELECT *` 时使用的列名查找函数
+func SetColumnLookup(lookup func(table string) ([]string, error)) {
+	columnLookup = lookup
+}
+
+// Rewrite 依次应用 rules 中点名启用的规则,规则本身的执行顺序固定为注册顺序
+func Rewrite(sql string, rules ...string) (string, error) {
+	enabled := make(map[string]bool, len(rules))
+	for _, name := range rules {
+		if _, ok := registry[name]; !ok {
+			return "", fmt.Errorf("rewrite: unknown rule %q", name)
+		}
+		enabled[name] = true
+	}
+
+	rw := &Statement{SQL: sql}
+	for _, name := range ruleOrder {
+		if !enabled[name] {
+			continue
+		}
+		rw = registry[name].Fn(rw)
+	}
+
+	return rw.SQL, nil
+}
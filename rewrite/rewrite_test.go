@@ -0,0 +1,169 @@
+package rewrite
+
+import "testing"
+
+func TestDML2Select(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "delete",
+			in:   "DELETE FROM `users` WHERE id = 5",
+			want: "SELECT * FROM `users` WHERE id = 5",
+		},
+		{
+			name: "update",
+			in:   "UPDATE users SET a=1, b=2 WHERE id=5",
+			want: "SELECT * FROM users WHERE id=5",
+		},
+		{
+			name: "select passes through",
+			in:   "SELECT * FROM users",
+			want: "SELECT * FROM users",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Rewrite(c.in, "dml2select")
+			if err != nil {
+				t.Fatalf("Rewrite() error = %v", err)
+			}
+			if got != c.want {
+				t.Errorf("Rewrite() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestStar2Columns(t *testing.T) {
+	defer SetColumnLookup(nil)
+
+	SetColumnLookup(func(table string) ([]string, error) {
+		if table != "users" {
+			t.Fatalf("unexpected table %q", table)
+		}
+		return []string{"id", "name"}, nil
+	})
+
+	got, err := Rewrite("SELECT * FROM users WHERE id > 1", "star2columns")
+	if err != nil {
+		t.Fatalf("Rewrite() error = %v", err)
+	}
+	want := "SELECT `id`,`name` FROM users WHERE id > 1"
+	if got != want {
+		t.Errorf("Rewrite() = %q, want %q", got, want)
+	}
+}
+
+func TestStar2ColumnsWithoutLookup(t *testing.T) {
+	defer SetColumnLookup(nil)
+	SetColumnLookup(nil)
+
+	in := "SELECT * FROM users"
+	got, err := Rewrite(in, "star2columns")
+	if err != nil {
+		t.Fatalf("Rewrite() error = %v", err)
+	}
+	if got != in {
+		t.Errorf("Rewrite() = %q, want unchanged %q", got, in)
+	}
+}
+
+func TestHaving2Where(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "non-aggregate condition pushed to where",
+			in:   "SELECT a, COUNT(*) FROM t GROUP BY a HAVING a > 1 AND COUNT(*) > 2",
+			want: "SELECT a, COUNT(*) FROM t WHERE a > 1 GROUP BY a HAVING COUNT(*) > 2",
+		},
+		{
+			name: "condition merged into existing where",
+			in:   "SELECT a, COUNT(*) FROM t WHERE x=1 GROUP BY a HAVING a > 1 AND COUNT(*) > 2",
+			want: "SELECT a, COUNT(*) FROM t WHERE x=1 AND a > 1 GROUP BY a HAVING COUNT(*) > 2",
+		},
+		{
+			name: "condition referencing an aggregate alias stays in having",
+			in:   "SELECT a, SUM(x) AS total FROM t WHERE x=1 GROUP BY a HAVING total > 5",
+			want: "SELECT a, SUM(x) AS total FROM t WHERE x=1 GROUP BY a HAVING total > 5",
+		},
+		{
+			name: "alias condition mixed with a pushable one",
+			in:   "SELECT a, SUM(x) AS total FROM t GROUP BY a HAVING a > 1 AND total > 5",
+			want: "SELECT a, SUM(x) AS total FROM t WHERE a > 1 GROUP BY a HAVING total > 5",
+		},
+		{
+			name: "no having clause is left untouched",
+			in:   "SELECT a FROM t GROUP BY a",
+			want: "SELECT a FROM t GROUP BY a",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Rewrite(c.in, "having2where")
+			if err != nil {
+				t.Fatalf("Rewrite() error = %v", err)
+			}
+			if got != c.want {
+				t.Errorf("Rewrite() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	defer SetDefaultLimit(1000)
+	SetDefaultLimit(10)
+
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "adds default limit", in: "SELECT * FROM t", want: "SELECT * FROM t LIMIT 10"},
+		{name: "leaves explicit limit alone", in: "SELECT * FROM t LIMIT 5", want: "SELECT * FROM t LIMIT 5"},
+		{name: "ignores non-select statements", in: "DELETE FROM t", want: "DELETE FROM t"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Rewrite(c.in, "limit")
+			if err != nil {
+				t.Fatalf("Rewrite() error = %v", err)
+			}
+			if got != c.want {
+				t.Errorf("Rewrite() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRewriteUnknownRule(t *testing.T) {
+	if _, err := Rewrite("SELECT 1", "does-not-exist"); err == nil {
+		t.Fatal("expected an error for an unknown rule name")
+	}
+}
+
+func TestRewriteAppliesRegisteredOrderRegardlessOfArgOrder(t *testing.T) {
+	defer SetColumnLookup(nil)
+	SetColumnLookup(func(string) ([]string, error) { return []string{"id"}, nil })
+
+	// dml2select must run before star2columns no matter which order the
+	// caller lists the rule names in, since ruleOrder (not the call site)
+	// decides execution order.
+	got, err := Rewrite("DELETE FROM users WHERE id=1", "star2columns", "dml2select")
+	if err != nil {
+		t.Fatalf("Rewrite() error = %v", err)
+	}
+	want := "SELECT `id` FROM users WHERE id=1"
+	if got != want {
+		t.Errorf("Rewrite() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// selectStarRegexp 匹配 "SELECT * FROM <table>",只处理单表且无别名的简单场景:
+// 表名后面只能是语句结尾或 WHERE/GROUP/ORDER/LIMIT
+var selectStarRegexp = regexp.MustCompile(`(?is)^\s*SELECT\s+\*\s+FROM\s+(` + "`" + `[^` + "`" + `]+` + "`" + `|\w+)(?:\s*;?\s*$|\s+(?:WHERE|GROUP|ORDER|LIMIT)\b)`)
+
+func init() {
+	Register(Rule{
+		Name:        "star2columns",
+		Description: "把 SELECT * 展开为 DDL 缓存中记录的具体列名",
+		Fn:          star2columns,
+	})
+}
+
+// star2columns 把 SELECT * 展开成具体列名,列名来自调用方通过
+// SetColumnLookup 注入的 DDL 缓存,未注册查找函数或查不到表时原样放行
+func star2columns(r *Statement) *Statement {
+	loc := selectStarRegexp.FindStringSubmatchIndex(r.SQL)
+	if loc == nil || columnLookup == nil {
+		return r
+	}
+
+	tableExpr := r.SQL[loc[2]:loc[3]]
+	table := strings.Trim(tableExpr, "`")
+	columns, err := columnLookup(table)
+	if err != nil || len(columns) == 0 {
+		return r
+	}
+
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = "`" + strings.Trim(c, "`") + "`"
+	}
+
+	// 只替换到表名为止,表名之后的 WHERE/GROUP/ORDER/LIMIT 等原样保留
+	r.SQL = fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ","), tableExpr) + r.SQL[loc[3]:]
+	return r
+}